@@ -0,0 +1,151 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+
+	_ "embed"
+)
+
+//go:embed assets/assets.bin
+var ASSETS_ARCHIVE []byte
+
+// entryKind distinguishes the kinds of filesystem object an archiveEntry can
+// materialize as.
+type entryKind int
+
+const (
+	entryFile entryKind = iota
+	entryDir
+	entrySymlink
+)
+
+// archiveEntry is a format-agnostic view of one entry in an assetArchive.
+type archiveEntry struct {
+	// Name is the entry's path, forward-slash separated and relative to the
+	// archive root; not yet zipslip-checked.
+	Name       string
+	Kind       entryKind
+	Mode       os.FileMode
+	LinkTarget string                        // only set when Kind == entrySymlink
+	Open       func() (io.ReadCloser, error) // only set when Kind == entryFile
+}
+
+// assetArchive abstracts over the container format used for the embedded
+// (or downloaded) asset blob.
+type assetArchive interface {
+	// forEachEntry calls fn once per entry, in archive order, stopping at
+	// the first error either reading the archive or returned by fn.
+	forEachEntry(fn func(entry archiveEntry) error) error
+}
+
+// newAssetArchive sniffs the magic bytes of data and returns the matching
+// assetArchive implementation: zip for Windows-built assets, tar+gzip or
+// tar+zstd for the unix ones (which need to preserve permissions/symlinks
+// that zip can't carry).
+func newAssetArchive(data []byte) (assetArchive, error) {
+	switch {
+	case len(data) >= 4 && data[0] == 'P' && data[1] == 'K':
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("reading zip asset archive: %s", err)
+		}
+		return &zipArchive{reader: r}, nil
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip asset archive: %s", err)
+		}
+		return &tarArchive{reader: tar.NewReader(gz)}, nil
+	case len(data) >= 4 && data[0] == 0x28 && data[1] == 0xb5 && data[2] == 0x2f && data[3] == 0xfd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading zstd asset archive: %s", err)
+		}
+		return &tarArchive{reader: tar.NewReader(zr.IOReadCloser())}, nil
+	default:
+		limit := len(data)
+		if limit > 4 {
+			limit = 4
+		}
+		return nil, fmt.Errorf("unrecognized asset archive format (magic bytes: % x)", data[:limit])
+	}
+}
+
+// zipArchive reads the Windows-targeted zip format. Zip doesn't carry Unix
+// permissions or symlinks in a way we rely on, so every entry is extracted
+// with DEFAULT_PERMISSIONS, same as before this format became pluggable.
+type zipArchive struct {
+	reader *zip.Reader
+}
+
+func (a *zipArchive) forEachEntry(fn func(archiveEntry) error) error {
+	for _, file := range a.reader.File {
+		kind := entryFile
+		if file.FileInfo().IsDir() {
+			kind = entryDir
+		}
+		entry := archiveEntry{
+			Name: file.Name,
+			Kind: kind,
+			Mode: DEFAULT_PERMISSIONS,
+			Open: file.Open,
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarArchive reads a tar stream (already decompressed by the caller),
+// preserving per-entry Unix permissions and symlinks.
+type tarArchive struct {
+	reader *tar.Reader
+}
+
+func (a *tarArchive) forEachEntry(fn func(archiveEntry) error) error {
+	for {
+		hdr, err := a.reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %s", err)
+		}
+
+		var kind entryKind
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			kind = entryDir
+		case tar.TypeSymlink:
+			kind = entrySymlink
+		default:
+			kind = entryFile
+		}
+
+		entry := archiveEntry{
+			Name:       hdr.Name,
+			Kind:       kind,
+			Mode:       os.FileMode(hdr.Mode) & os.ModePerm,
+			LinkTarget: hdr.Linkname,
+		}
+		if kind == entryFile {
+			tr := a.reader
+			entry.Open = func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			}
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
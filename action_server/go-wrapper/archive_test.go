@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractSymlinkRejectsEscapingTarget(t *testing.T) {
+	dest := t.TempDir()
+	entry := archiveEntry{Name: "link", Kind: entrySymlink, LinkTarget: "../../etc/passwd"}
+
+	if err := extractSymlink(dest, filepath.Join(dest, "link"), entry); err == nil {
+		t.Fatal("expected extractSymlink to reject a target that resolves outside dest")
+	}
+	if exists(filepath.Join(dest, "link")) {
+		t.Error("extractSymlink should not create a symlink that resolves outside dest")
+	}
+}
+
+func TestExtractSymlinkRejectsAbsoluteEscape(t *testing.T) {
+	dest := t.TempDir()
+	entry := archiveEntry{Name: "link", Kind: entrySymlink, LinkTarget: "/etc/passwd"}
+
+	if err := extractSymlink(dest, filepath.Join(dest, "link"), entry); err == nil {
+		t.Fatal("expected extractSymlink to reject an absolute target outside dest")
+	}
+}
+
+func TestExtractSymlinkAllowsContainedTarget(t *testing.T) {
+	dest := t.TempDir()
+	entry := archiveEntry{Name: "nested/link", Kind: entrySymlink, LinkTarget: "../sibling"}
+	destPath := filepath.Join(dest, "nested", "link")
+
+	if err := extractSymlink(dest, destPath, entry); err != nil {
+		t.Fatalf("extractSymlink should allow a target that stays inside dest: %s", err)
+	}
+	target, err := os.Readlink(destPath)
+	if err != nil {
+		t.Fatalf("reading created symlink: %s", err)
+	}
+	if target != entry.LinkTarget {
+		t.Errorf("symlink target = %q, want %q", target, entry.LinkTarget)
+	}
+}
+
+func TestNewAssetArchiveUnrecognizedFormat(t *testing.T) {
+	if _, err := newAssetArchive([]byte("not an archive")); err == nil {
+		t.Fatal("expected an error for unrecognized archive magic bytes")
+	}
+}
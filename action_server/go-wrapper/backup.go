@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// launchGracePeriod is how long a freshly (re-)extracted version is given to
+// prove it comes up cleanly before its .bak directory is discarded.
+const launchGracePeriod = 5 * time.Second
+
+// wrapperOnlyFlags are understood by this wrapper and must never reach the
+// wrapped executable, which has no idea what to do with them.
+var wrapperOnlyFlags = map[string]bool{
+	selfUpdateFlag: true,
+	noPruneFlag:    true,
+}
+
+// forwardedArgs returns os.Args[1:] with wrapper-only flags stripped.
+func forwardedArgs() []string {
+	args := make([]string, 0, len(os.Args)-1)
+	for _, arg := range os.Args[1:] {
+		if wrapperOnlyFlags[arg] {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// launchAndWatch starts executablePath and waits for it to finish. If it
+// exits with an error within launchGracePeriod, that's treated as a launch
+// failure and reported as such, returning false so the caller can roll back.
+// A failure after the grace period is unrelated to the just-applied update,
+// so it's fatal and this never returns.
+func launchAndWatch(executablePath string, exeName string) bool {
+	cmd := exec.Command(executablePath, forwardedArgs()...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error executing %s: %s\n", exeName, err)
+		return false
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s exited right after launching: %s\n", exeName, err)
+			return false
+		}
+		return true
+	case <-time.After(launchGracePeriod):
+		// Past the grace period, so a later failure is no longer a rollback
+		// candidate: report it and exit like a normal run would.
+		if err := <-done; err != nil {
+			fmt.Fprintf(os.Stderr, "Error executing %s: %s\n", exeName, err)
+			os.Exit(1)
+		}
+		return true
+	}
+}
+
+// restoreBackup replaces targetDirectory with backupDirectory.
+func restoreBackup(targetDirectory, backupDirectory string) error {
+	if err := os.RemoveAll(targetDirectory); err != nil {
+		return fmt.Errorf("removing failed version at %s: %s", targetDirectory, err)
+	}
+	if err := os.Rename(backupDirectory, targetDirectory); err != nil {
+		return fmt.Errorf("restoring backup from %s: %s", backupDirectory, err)
+	}
+	return nil
+}
+
+// runWithRollback launches executablePath, rolling back to targetDirectory's
+// .bak (left behind by a two-phase asset expansion, only when there was a
+// completed prior install to back up) and retrying once if the new version
+// fails immediately. The .bak is removed once a launch is deemed healthy.
+func runWithRollback(config RunConfig, targetDirectory, executablePath string) {
+	backupDirectory := targetDirectory + ".bak"
+
+	if launchAndWatch(executablePath, config.ExecutableName) {
+		os.RemoveAll(backupDirectory)
+		return
+	}
+
+	if !hasCompletedInstall(backupDirectory) {
+		os.Exit(1) // nothing (real) to roll back to
+	}
+
+	fmt.Fprintf(os.Stderr, "Rolling back %s to the previous version and retrying...\n", config.ExecutableName)
+	if err := restoreBackup(targetDirectory, backupDirectory); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rolling back %s: %s\n", targetDirectory, err)
+		os.Exit(1)
+	}
+
+	if !launchAndWatch(executablePath, config.ExecutableName) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForwardedArgsStripsWrapperOnlyFlags(t *testing.T) {
+	previousArgs := os.Args
+	t.Cleanup(func() { os.Args = previousArgs })
+
+	os.Args = []string{"action-server", "start", "--self-update", "--no-prune", "--port", "8080"}
+	got := forwardedArgs()
+	want := []string{"start", "--port", "8080"}
+
+	if len(got) != len(want) {
+		t.Fatalf("forwardedArgs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("forwardedArgs() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "1.0.0")
+	backup := target + ".bak"
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatalf("creating target: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "marker"), []byte("broken"), 0644); err != nil {
+		t.Fatalf("writing marker in target: %s", err)
+	}
+	if err := os.MkdirAll(backup, 0755); err != nil {
+		t.Fatalf("creating backup: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(backup, "marker"), []byte("good"), 0644); err != nil {
+		t.Fatalf("writing marker in backup: %s", err)
+	}
+
+	if err := restoreBackup(target, backup); err != nil {
+		t.Fatalf("restoreBackup: %s", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(target, "marker"))
+	if err != nil {
+		t.Fatalf("reading restored marker: %s", err)
+	}
+	if string(content) != "good" {
+		t.Errorf("restored target has marker %q, want %q", content, "good")
+	}
+	if exists(backup) {
+		t.Error("restoreBackup should consume the backup directory")
+	}
+}
+
+// TestLaunchAndWatchHelperProcess isn't a real test: it's re-executed as a
+// subprocess by runLaunchAndWatch (the standard os/exec test-helper-process
+// pattern), acting as a stand-in for the wrapped action-server binary that
+// either exits cleanly or fails immediately.
+func TestLaunchAndWatchHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+	if os.Getenv("GO_HELPER_BEHAVIOR") == "fail" {
+		os.Exit(1)
+	}
+}
+
+func runLaunchAndWatch(t *testing.T, behavior string) bool {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Skipf("cannot locate the test binary: %s", err)
+	}
+
+	previousArgs := os.Args
+	t.Cleanup(func() { os.Args = previousArgs })
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("GO_HELPER_BEHAVIOR", behavior)
+	os.Args = []string{previousArgs[0], "-test.run=TestLaunchAndWatchHelperProcess"}
+
+	return launchAndWatch(self, "test-helper")
+}
+
+func TestLaunchAndWatchReportsSuccess(t *testing.T) {
+	if !runLaunchAndWatch(t, "succeed") {
+		t.Error("launchAndWatch should report success for a process that exits cleanly")
+	}
+}
+
+func TestLaunchAndWatchReportsImmediateFailure(t *testing.T) {
+	if runLaunchAndWatch(t, "fail") {
+		t.Error("launchAndWatch should report failure for a process that exits nonzero immediately")
+	}
+}
@@ -1,15 +1,12 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
@@ -22,9 +19,6 @@ import (
 	_ "embed"
 )
 
-//go:embed assets/assets.zip
-var ASSETS_ZIP []byte
-
 //go:embed assets/version.txt
 var ASSETS_VERSION []byte
 
@@ -84,6 +78,12 @@ func checkAvailableUpdate(version string, config RunConfig) {
 	if compareResult == -1 {
 		colorT := &ColorType{}
 		fmt.Fprintf(os.Stderr, "\n ⏫ A new version of %s is now available: %s → %s \n", config.ExecutableName, colorT.Yellow(version), colorT.Green(latestVersion))
+
+		if selfUpdateRequested() {
+			selfUpdate(config, latestVersion)
+			return
+		}
+
 		if runtime.GOOS == "darwin" && config.ShowBrewMessage != "" {
 			fmt.Fprintf(os.Stderr, "    To update, download from: %s \n", colorT.Bold(config.DownloadLatestURL))
 			fmt.Fprintf(os.Stderr, "    Or run: %s \n\n", colorT.Bold(config.ShowBrewMessage))
@@ -93,68 +93,114 @@ func checkAvailableUpdate(version string, config RunConfig) {
 	}
 }
 
-func expandAssets(dest string) error {
+// variantEntryName maps an archive entry to the name it should be extracted
+// under, given the amd64 variant selected for this launch. Entries under
+// "variants/<vN>/" are only extracted for the matching variant (with the
+// prefix stripped); everything else is shared across variants and always
+// extracted. The second return value is false if the entry should be skipped.
+func variantEntryName(name, variant string) (string, bool) {
+	const variantsPrefix = "variants/"
+	if !strings.HasPrefix(name, variantsPrefix) {
+		return name, true
+	}
+	variantDir := variant
+	if variantDir == "" {
+		variantDir = "v1"
+	}
+	prefix := variantsPrefix + variantDir + "/"
+	if !strings.HasPrefix(name, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(name, prefix), true
+}
+
+func expandAssets(dest, variant string) error {
 	if debugGoWrapper {
-		fmt.Fprintf(os.Stderr, "Expanding assets to: %s (pid: %d)\n", dest, os.Getpid())
+		fmt.Fprintf(os.Stderr, "Expanding assets to: %s (variant: %q, pid: %d)\n", dest, variant, os.Getpid())
 	}
 
-	// Create a reader for the zip content
-	zipReader, err := zip.NewReader(bytes.NewReader(ASSETS_ZIP), int64(len(ASSETS_ZIP)))
+	archive, err := newAssetArchive(ASSETS_ARCHIVE)
 	if err != nil {
 		return err
 	}
 
-	// Extract each file from the zip
-	for _, file := range zipReader.File {
-		if strings.Contains(file.Name, "..") {
+	err = archive.forEachEntry(func(entry archiveEntry) error {
+		if strings.Contains(entry.Name, "..") {
 			// This is a security check to avoid directory traversal attacks (CodeQL: go/zipslip)
-			panic(fmt.Sprintf("Error: found '..' in file name %s (in embedded zip assets)\n", file.Name))
+			panic(fmt.Sprintf("Error: found '..' in file name %s (in embedded assets)\n", entry.Name))
 		}
-		destPath := filepath.Join(dest, file.Name)
-
-		if file.FileInfo().IsDir() {
-			err := os.MkdirAll(destPath, DEFAULT_PERMISSIONS)
-			if err != nil {
-				return err
-			}
-			continue
+		name, ok := variantEntryName(entry.Name, variant)
+		if !ok || name == "" {
+			return nil // a different amd64 variant, or the variant directory entry itself
 		}
+		destPath := filepath.Join(dest, name)
 
-		// Create destination directory if it doesn't exist
-		err := os.MkdirAll(filepath.Dir(destPath), DEFAULT_PERMISSIONS)
-		if err != nil {
-			return err
+		switch entry.Kind {
+		case entryDir:
+			return os.MkdirAll(destPath, entry.Mode)
+		case entrySymlink:
+			return extractSymlink(dest, destPath, entry)
+		default:
+			return extractFile(destPath, entry)
 		}
+	})
+	if err != nil {
+		return err
+	}
 
-		// Open the file from the zip
-		rc, err := file.Open()
-		if err != nil {
-			return err
-		}
+	if err := verifyExtractedAssets(dest, variant); err != nil {
+		return fmt.Errorf("asset integrity check failed: %s", err)
+	}
 
-		// Create the destination file
-		destFile, err := os.Create(destPath)
-		if err != nil {
-			rc.Close()
-			return err
-		}
+	return nil
+}
 
-		// Copy the contents
-		_, err = io.Copy(destFile, rc)
-		rc.Close()
-		destFile.Close()
-		if err != nil {
-			return err
-		}
+// extractFile writes a regular file entry to destPath, creating parent
+// directories as needed and applying the entry's permissions.
+func extractFile(destPath string, entry archiveEntry) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), DEFAULT_PERMISSIONS); err != nil {
+		return err
+	}
 
-		// Set the file permissions
-		err = os.Chmod(destPath, DEFAULT_PERMISSIONS)
-		if err != nil {
-			return err
-		}
+	rc, err := entry.Open()
+	if err != nil {
+		return err
 	}
+	defer rc.Close()
 
-	return nil
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destFile, rc)
+	destFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(destPath, entry.Mode)
+}
+
+// extractSymlink creates a symlink at destPath from a tar symlink entry,
+// refusing to create it if the link target would resolve outside dest.
+func extractSymlink(dest, destPath string, entry archiveEntry) error {
+	resolved := entry.LinkTarget
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(destPath), resolved)
+	}
+	resolved = filepath.Clean(resolved)
+
+	rel, err := filepath.Rel(dest, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink %s -> %s resolves outside %s", entry.Name, entry.LinkTarget, dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), DEFAULT_PERMISSIONS); err != nil {
+		return err
+	}
+	os.Remove(destPath) // overwrite if re-extracting
+	return os.Symlink(entry.LinkTarget, destPath)
 }
 
 func isDirEmpty(path string) bool {
@@ -192,6 +238,15 @@ func zipHashMatches(zipHash, targetDirectory string) ZipHashMatches {
 	return HashDoesNotMatch
 }
 
+// hasCompletedInstall reports whether dir holds a fully-expanded previous
+// install, signaled (like zipHashMatches) by a non-empty app_hash, as
+// opposed to just an empty placeholder directory (e.g. the one MkdirAll'd
+// for a brand-new installation that hasn't been populated yet).
+func hasCompletedInstall(dir string) bool {
+	hash, err := os.ReadFile(filepath.Join(dir, "app_hash"))
+	return err == nil && len(hash) > 0
+}
+
 const LOCK_TIMEOUT = 120 * time.Second
 
 func obtainLock(lockFile string) (*flock.Flock, error) {
@@ -215,7 +270,7 @@ func obtainLock(lockFile string) (*flock.Flock, error) {
 	return fileLock, nil
 }
 
-func makeAssetExpansion(targetDirectory string, zipHash string) error {
+func makeAssetExpansion(targetDirectory string, zipHash string, variant string) error {
 	if debugGoWrapper {
 		fmt.Fprintf(os.Stderr, "Requesting assets expansion to: %s\n", targetDirectory)
 	}
@@ -226,8 +281,7 @@ func makeAssetExpansion(targetDirectory string, zipHash string) error {
 		return fmt.Errorf("Error creating parent directory: %s\n", err)
 	}
 
-	lockFile := filepath.Join(targetDirectory, "extract.lock")
-	fileLock, err := obtainLock(lockFile)
+	fileLock, err := obtainLock(extractLockPath(targetDirectory))
 	if err != nil {
 		return fmt.Errorf("Error obtaining lock: %s\n", err)
 	}
@@ -271,21 +325,98 @@ Please remove the contents to force an update. Proceeding with the launch with e
 		}
 	}
 
-	// Extract assets to the target path
-	err = expandAssets(targetDirectory)
-	if err != nil {
+	// Extract to a staging directory first and only swap it into place once
+	// it's fully populated and verified, so a failure partway through never
+	// leaves targetDirectory (and whatever state the embedded app wrote
+	// there) half-overwritten.
+	stagingDirectory := targetDirectory + ".new"
+	if err := os.RemoveAll(stagingDirectory); err != nil {
+		return fmt.Errorf("Error clearing leftover staging directory %s: %s\n", stagingDirectory, err)
+	}
+	if err := os.MkdirAll(stagingDirectory, DEFAULT_PERMISSIONS); err != nil {
+		return fmt.Errorf("Error creating staging directory %s: %s\n", stagingDirectory, err)
+	}
+
+	if err := expandAssets(stagingDirectory, variant); err != nil {
+		os.RemoveAll(stagingDirectory)
 		return fmt.Errorf("Error extracting the zip file with the assets: %s\n", err)
 	}
 
-	// To finalize, write the zip hash to the target directory
-	err = os.WriteFile(filepath.Join(targetDirectory, "app_hash"), []byte(zipHash), 0644)
-	if err != nil {
+	// To finalize, write the zip hash to the staging directory
+	if err := os.WriteFile(filepath.Join(stagingDirectory, "app_hash"), []byte(zipHash), 0644); err != nil {
+		os.RemoveAll(stagingDirectory)
 		return fmt.Errorf("Error writing app_hash: %s\n", err)
 	}
 
+	// Move the target out of the way so it can be restored if the newly
+	// staged version fails to launch, then promote the staging directory
+	// into place. Only do this if the target actually holds a completed
+	// prior install, not just the empty placeholder directory created above
+	// for a brand-new installation: backing up (and later treating as a
+	// rollback candidate) a directory with nothing real in it would let a
+	// launch failure destroy the good, just-extracted assets instead of
+	// just being reported.
+	backupDirectory := targetDirectory + ".bak"
+	os.RemoveAll(backupDirectory) // only the most recent backup is kept
+	if hasCompletedInstall(targetDirectory) {
+		if err := os.Rename(targetDirectory, backupDirectory); err != nil {
+			os.RemoveAll(stagingDirectory)
+			return fmt.Errorf("Error backing up %s: %s\n", targetDirectory, err)
+		}
+	} else if err := os.RemoveAll(targetDirectory); err != nil {
+		os.RemoveAll(stagingDirectory)
+		return fmt.Errorf("Error clearing %s: %s\n", targetDirectory, err)
+	}
+	if err := os.Rename(stagingDirectory, targetDirectory); err != nil {
+		// Put the previous contents back so we don't leave nothing in place.
+		os.Rename(backupDirectory, targetDirectory)
+		return fmt.Errorf("Error promoting staged assets to %s: %s\n", targetDirectory, err)
+	}
+
 	return nil
 }
 
+// extractLockPath returns the lock file makeAssetExpansion and
+// pruneOldVersions serialize on, as a sibling of targetDirectory rather than
+// a file inside it: targetDirectory gets renamed out from under this lock's
+// open file descriptor partway through makeAssetExpansion (to the .bak path),
+// which would otherwise leave the lock orphaned in the old location.
+func extractLockPath(targetDirectory string) string {
+	return targetDirectory + ".lock"
+}
+
+// livenessLockPath returns the lock file pruneOldVersions checks to tell
+// whether a version directory is still in use by a running process, as a
+// sibling of targetDirectory (like its .bak/.new staging directories) rather
+// than a file inside it, since targetDirectory itself gets renamed away
+// during a later asset expansion.
+func livenessLockPath(targetDirectory string) string {
+	return targetDirectory + ".running.lock"
+}
+
+// heldLivenessLock is the liveness lock taken by acquireLivenessLock.
+var heldLivenessLock *flock.Flock
+
+// acquireLivenessLock takes a shared lock on targetDirectory's liveness lock
+// file, signaling to pruneOldVersions that this version is currently in use.
+// It's a best-effort, non-fatal step: failing to lock just means pruning
+// won't know this version is busy, not that the launch should be aborted.
+// The lock is intentionally never released by this process; it's held until
+// the process exits.
+func acquireLivenessLock(targetDirectory string) {
+	fileLock := flock.New(livenessLockPath(targetDirectory))
+	// Kept reachable so the lock file's descriptor isn't closed (releasing the
+	// lock) when the garbage collector finalizes an unreferenced *os.File.
+	heldLivenessLock = fileLock
+
+	ctx, cancel := context.WithTimeout(context.Background(), LOCK_TIMEOUT)
+	defer cancel()
+
+	if _, err := fileLock.TryRLockContext(ctx, 250*time.Millisecond); err != nil && debugGoWrapper {
+		fmt.Fprintf(os.Stderr, "(ignored) Unable to take liveness lock for %s: %s\n", targetDirectory, err)
+	}
+}
+
 func unlock(fileLock *flock.Flock) {
 	if debugGoWrapper {
 		fmt.Fprintf(os.Stderr, "> Unlocking the file %s (pid: %d)\n", fileLock.Path(), os.Getpid())
@@ -302,6 +433,9 @@ type RunConfig struct {
 	VersionLatestURL  string
 	DoUpdateCheck     bool
 	ShowBrewMessage   string
+	// Variant is the amd64 microarchitecture variant selected for this
+	// launch ("", "v2" or "v3"); empty on non-amd64 platforms and on macOS.
+	Variant string
 }
 
 func forceTouchWhen(path string, when time.Time) {
@@ -317,12 +451,34 @@ func forceTouchWhen(path string, when time.Time) {
 	}
 }
 
+// computeTargetDirectory returns the per-version asset directory for exeName,
+// mirroring the ~/.sema4ai/bin/<exe>/internal/<version> (or the Windows
+// %LOCALAPPDATA% equivalent) layout used both when extracting the embedded
+// assets and when staging a self-update.
+func computeTargetDirectory(exeName, version string) (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		appDataDir := os.Getenv("LOCALAPPDATA")
+		if appDataDir == "" {
+			return "", fmt.Errorf("LOCALAPPDATA environment variable is not set")
+		}
+		return fmt.Sprintf("%s\\sema4ai\\bin\\%s\\internal\\%s", appDataDir, exeName, version), nil
+	case "linux", "darwin":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("getting user home directory: %s", err)
+		}
+		return fmt.Sprintf("%s/.sema4ai/bin/%s/internal/%s", homeDir, exeName, version), nil
+	default:
+		return "", fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+	}
+}
+
 func extractAndRun(config RunConfig) {
 	if debugGoWrapper {
 		fmt.Fprintf(os.Stderr, "Debug mode enabled (SEMA4AI_GO_WRAPPER_DEBUG=1)\n")
 	}
 
-	var targetDirectory string
 	var executablePath string
 
 	// Get the app hash for the zip file
@@ -340,26 +496,15 @@ func extractAndRun(config RunConfig) {
 	}
 
 	// Determine the appropriate path based on the operating system
-	switch runtime.GOOS {
-	case "windows":
-		appDataDir := os.Getenv("LOCALAPPDATA")
-		if appDataDir == "" {
-			fmt.Fprintf(os.Stderr, "Error getting local app data directory (LOCALAPPDATA environment variable is not set)\n")
-			os.Exit(1)
-		}
-		targetDirectory = fmt.Sprintf("%s\\sema4ai\\bin\\%s\\internal\\%s", appDataDir, config.ExecutableName, version)
+	targetDirectory, err := computeTargetDirectory(config.ExecutableName, version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error determining target directory: %s\n", err)
+		os.Exit(1)
+	}
+	if runtime.GOOS == "windows" {
 		executablePath = filepath.Join(targetDirectory, fmt.Sprintf("%s.exe", config.ExecutableName))
-	case "linux", "darwin":
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error getting user home directory: %s\n", err)
-			os.Exit(1)
-		}
-		targetDirectory = fmt.Sprintf("%s/.sema4ai/bin/%s/internal/%s", homeDir, config.ExecutableName, version)
+	} else {
 		executablePath = filepath.Join(targetDirectory, config.ExecutableName)
-	default:
-		fmt.Fprintf(os.Stderr, "Unsupported operating system\n")
-		os.Exit(1)
 	}
 
 	if debugGoWrapper {
@@ -368,9 +513,9 @@ func extractAndRun(config RunConfig) {
 	}
 
 	// If the folder doesn't exist already, we create it and copy all files
-	_, err := os.Stat(targetDirectory)
+	_, err = os.Stat(targetDirectory)
 	if os.IsNotExist(err) || isDirEmpty(targetDirectory) || zipHashMatches(zipHash, targetDirectory) != HashMatches {
-		err = makeAssetExpansion(targetDirectory, zipHash)
+		err = makeAssetExpansion(targetDirectory, zipHash, config.Variant)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error expanding assets to %s.\n%s", targetDirectory, err)
 			os.Exit(1)
@@ -384,30 +529,39 @@ func extractAndRun(config RunConfig) {
 	touchFile := filepath.Join(targetDirectory, "lastLaunchTouch")
 	forceTouchWhen(touchFile, time.Now())
 
-	cmd := exec.Command(executablePath, os.Args[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	// Held (never explicitly unlocked) for the rest of this process's life, so
+	// pruneOldVersions can tell this version is still running and not just
+	// launched once a while ago.
+	acquireLivenessLock(targetDirectory)
 
-	err = cmd.Run()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error executing %s: %s\n", config.ExecutableName, err)
-		os.Exit(1)
+	if pruneRequested() {
+		// Run in the background so a slow/contended prune never delays startup.
+		go pruneOldVersions(filepath.Dir(targetDirectory), version, keepVersionsFromEnv(), pruneMaxAgeFromEnv())
 	}
+
+	runWithRollback(config, targetDirectory, executablePath)
 }
 
 func main() {
 	const ACTION_SERVER_LATEST_BASE_URL = "https://cdn.sema4.ai/action-server/releases/latest/"
 	const VERSION_LATEST_URL = ACTION_SERVER_LATEST_BASE_URL + "version.txt"
 
-	var osPathInUrl, actionExe string
+	var osPathInUrl, actionExe, variant string
 	switch runtime.GOOS {
 	case "windows":
 		osPathInUrl = "windows64"
 		actionExe = "action-server.exe"
+		if runtime.GOARCH == "amd64" {
+			variant = amd64Variant()
+			actionExe = "action-server" + variantSuffix(variant) + ".exe"
+		}
 	case "linux":
 		osPathInUrl = "linux64"
 		actionExe = "action-server"
+		if runtime.GOARCH == "amd64" {
+			variant = amd64Variant()
+			actionExe = "action-server" + variantSuffix(variant)
+		}
 	case "darwin":
 		actionExe = "action-server"
 		switch runtime.GOARCH {
@@ -431,6 +585,7 @@ func main() {
 		VersionLatestURL:  VERSION_LATEST_URL,
 		DoUpdateCheck:     true,
 		ShowBrewMessage:   "brew update && brew install sema4ai/tools/action-server",
+		Variant:           variant,
 	}
 
 	extractAndRun(config)
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTarGzAsset builds a minimal tar.gz asset archive containing a single
+// regular file "action-server" with the given content, and returns it
+// alongside the corresponding signed manifest.
+func buildTarGzAsset(t *testing.T, content []byte) (archive []byte, manifestBytes, sig []byte) {
+	t.Helper()
+
+	var archiveBuf bytes.Buffer
+	gz := gzip.NewWriter(&archiveBuf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "action-server", Mode: 0755, Size: int64(len(content))}); err != nil {
+		t.Fatalf("writing tar header: %s", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("writing tar content: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("closing gzip writer: %s", err)
+	}
+
+	digest, size, err := hashBytes(t, content)
+	if err != nil {
+		t.Fatalf("hashing content: %s", err)
+	}
+	manifestBytes, err = json.Marshal(Manifest{Entries: []ManifestEntry{
+		{File: "action-server", SHA256: digest, Size: size},
+	}})
+	if err != nil {
+		t.Fatalf("marshaling manifest: %s", err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %s", err)
+	}
+	withManifestKey(t, pub)
+	sig = ed25519.Sign(priv, manifestBytes)
+
+	return archiveBuf.Bytes(), manifestBytes, sig
+}
+
+// hashBytes hashes content with hashFile, by way of a temporary file, and is
+// used to build test manifests.
+func hashBytes(t *testing.T, content []byte) (string, int64, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", 0, err
+	}
+	return hashFile(path)
+}
+
+// withAssets swaps the embedded archive/manifest/signature package vars for
+// the duration of the test.
+func withAssets(t *testing.T, archive, manifestBytes, sig []byte) {
+	t.Helper()
+	previousArchive, previousManifest, previousSig := ASSETS_ARCHIVE, ASSETS_MANIFEST, ASSETS_MANIFEST_SIG
+	ASSETS_ARCHIVE, ASSETS_MANIFEST, ASSETS_MANIFEST_SIG = archive, manifestBytes, sig
+	t.Cleanup(func() {
+		ASSETS_ARCHIVE, ASSETS_MANIFEST, ASSETS_MANIFEST_SIG = previousArchive, previousManifest, previousSig
+	})
+}
+
+func TestHasCompletedInstall(t *testing.T) {
+	dir := t.TempDir()
+	if hasCompletedInstall(dir) {
+		t.Error("a directory with no app_hash at all should not count as a completed install")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "app_hash"), nil, 0644); err != nil {
+		t.Fatalf("writing empty app_hash: %s", err)
+	}
+	if hasCompletedInstall(dir) {
+		t.Error("a directory with an empty app_hash should not count as a completed install")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "app_hash"), []byte("deadbeef"), 0644); err != nil {
+		t.Fatalf("writing app_hash: %s", err)
+	}
+	if !hasCompletedInstall(dir) {
+		t.Error("a directory with a non-empty app_hash should count as a completed install")
+	}
+}
+
+// TestMakeAssetExpansionFreshInstallLeavesNoBackup reproduces the scenario
+// from the maintainer's review: a brand-new install must not leave a .bak
+// behind, since there's no real prior install to roll back to. If it did,
+// a crash on first launch would make runWithRollback destroy the good,
+// just-extracted assets and replace them with that empty placeholder.
+func TestMakeAssetExpansionFreshInstallLeavesNoBackup(t *testing.T) {
+	archive, manifestBytes, sig := buildTarGzAsset(t, []byte("binary-contents"))
+	withAssets(t, archive, manifestBytes, sig)
+
+	root := t.TempDir()
+	targetDirectory := filepath.Join(root, "1.0.0")
+
+	if err := makeAssetExpansion(targetDirectory, "zip-hash", ""); err != nil {
+		t.Fatalf("makeAssetExpansion: %s", err)
+	}
+
+	if exists(targetDirectory + ".bak") {
+		t.Error("a fresh install must not leave a .bak behind: there's nothing real to back up")
+	}
+	if !exists(filepath.Join(targetDirectory, "action-server")) {
+		t.Error("expected the extracted binary to be present")
+	}
+}
+
+// TestMakeAssetExpansionUpgradeBacksUpCompletedInstall checks the opposite
+// side: re-expanding over a directory that DOES hold a completed prior
+// install (the "local version" override path) must still back it up, so
+// runWithRollback has something genuine to restore if the upgrade's binary
+// crashes immediately.
+func TestMakeAssetExpansionUpgradeBacksUpCompletedInstall(t *testing.T) {
+	root := t.TempDir()
+	targetDirectory := filepath.Join(root, "1.0.0-local")
+	if err := os.MkdirAll(targetDirectory, DEFAULT_PERMISSIONS); err != nil {
+		t.Fatalf("creating pre-existing install dir: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDirectory, "app_hash"), []byte("old-hash"), 0644); err != nil {
+		t.Fatalf("seeding pre-existing app_hash: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(targetDirectory, "action-server"), []byte("old-binary"), 0755); err != nil {
+		t.Fatalf("seeding pre-existing binary: %s", err)
+	}
+
+	previousVersion := ASSETS_VERSION
+	ASSETS_VERSION = []byte("1.0.0-local")
+	t.Cleanup(func() { ASSETS_VERSION = previousVersion })
+
+	archive, manifestBytes, sig := buildTarGzAsset(t, []byte("new-binary-contents"))
+	withAssets(t, archive, manifestBytes, sig)
+
+	if err := makeAssetExpansion(targetDirectory, "new-zip-hash", ""); err != nil {
+		t.Fatalf("makeAssetExpansion: %s", err)
+	}
+
+	if !hasCompletedInstall(targetDirectory + ".bak") {
+		t.Error("upgrading over a completed install should back it up for a real rollback")
+	}
+	content, err := os.ReadFile(filepath.Join(targetDirectory, "action-server"))
+	if err != nil {
+		t.Fatalf("reading the upgraded binary: %s", err)
+	}
+	if string(content) != "new-binary-contents" {
+		t.Errorf("expected the upgraded binary to be in place, got %q", content)
+	}
+}
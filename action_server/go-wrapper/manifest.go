@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	_ "embed"
+)
+
+//go:embed assets/manifest.json
+var ASSETS_MANIFEST []byte
+
+//go:embed assets/manifest.sig
+var ASSETS_MANIFEST_SIG []byte
+
+//go:embed assets/manifest_pubkey.txt
+var MANIFEST_PUBLIC_KEY_HEX []byte
+
+// ManifestEntry describes one file covered by a signed manifest.
+type ManifestEntry struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest is the signed list of files (and their expected hash/size)
+// shipped alongside either the embedded assets or a downloadable release.
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// manifestPublicKey decodes the Ed25519 public key embedded in the wrapper.
+func manifestPublicKey() (ed25519.PublicKey, error) {
+	keyHex := strings.TrimSpace(string(MANIFEST_PUBLIC_KEY_HEX))
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, fmt.Errorf("decoding embedded manifest public key: %s", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("embedded manifest public key has unexpected size %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// parseAndVerifyManifest checks manifestBytes against sig using the embedded
+// public key and, only if it's valid, parses it as JSON.
+func parseAndVerifyManifest(manifestBytes, sig []byte) (*Manifest, error) {
+	pubKey, err := manifestPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pubKey, manifestBytes, sig) {
+		return nil, fmt.Errorf("manifest signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %s", err)
+	}
+	return &manifest, nil
+}
+
+// findManifestEntry looks up the entry for the given file name (relative to
+// the archive/manifest root).
+func findManifestEntry(manifest *Manifest, file string) (ManifestEntry, bool) {
+	for _, entry := range manifest.Entries {
+		if entry.File == file {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// hashFile streams path through sha256 and returns the hex digest and size.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// verifyEntry hashes path and compares it against entry, returning a
+// descriptive error on mismatch.
+func verifyEntry(path string, entry ManifestEntry) error {
+	digest, size, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %s", path, err)
+	}
+	if size != entry.Size {
+		return fmt.Errorf("%s: size mismatch (expected %d, got %d)", entry.File, entry.Size, size)
+	}
+	if digest != entry.SHA256 {
+		return fmt.Errorf("%s: sha256 mismatch (expected %s, got %s)", entry.File, entry.SHA256, digest)
+	}
+	return nil
+}
+
+// verifyExtractedAssets verifies the files under dest that the embedded,
+// signature-checked manifest lists; files under dest that the manifest does
+// not list are not checked. The manifest lists raw archive paths (including
+// the "variants/<vN>/" entries for every amd64 variant), so each entry is
+// mapped through variantEntryName the same way expandAssets mapped it when
+// extracting, to land on the entry that actually matches what's on disk for
+// the selected variant.
+func verifyExtractedAssets(dest, variant string) error {
+	manifest, err := parseAndVerifyManifest(ASSETS_MANIFEST, ASSETS_MANIFEST_SIG)
+	if err != nil {
+		return err
+	}
+	for _, entry := range manifest.Entries {
+		name, ok := variantEntryName(entry.File, variant)
+		if !ok || name == "" {
+			continue // a different amd64 variant, or the variant directory entry itself
+		}
+		if err := verifyEntry(filepath.Join(dest, name), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRemoteManifest downloads manifest.json and manifest.sig from baseURL,
+// verifies the signature and returns the parsed manifest.
+func fetchRemoteManifest(baseURL string) (*Manifest, error) {
+	manifestBytes, err := fetchURL(baseURL, "manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	sigBytes, err := fetchURL(baseURL, "manifest.sig")
+	if err != nil {
+		return nil, err
+	}
+	return parseAndVerifyManifest(manifestBytes, sigBytes)
+}
+
+// manifestBaseURL returns the directory a download URL lives in, e.g.
+// ".../linux64/action-server" -> ".../linux64/", where manifest.json and
+// manifest.sig are expected to live alongside the binary.
+func manifestBaseURL(downloadURL string) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %s", downloadURL, err)
+	}
+	u.Path = path.Dir(u.Path) + "/"
+	return u.String(), nil
+}
+
+func fetchURL(baseURL, name string) ([]byte, error) {
+	fullURL, err := url.JoinPath(baseURL, name)
+	if err != nil {
+		return nil, fmt.Errorf("building URL for %s: %s", name, err)
+	}
+	resp, err := http.Get(fullURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %s", fullURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: unexpected status %s", fullURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withManifestKey swaps the embedded manifest public key for pub for the
+// duration of the test.
+func withManifestKey(t *testing.T, pub ed25519.PublicKey) {
+	t.Helper()
+	previous := MANIFEST_PUBLIC_KEY_HEX
+	MANIFEST_PUBLIC_KEY_HEX = []byte(hex.EncodeToString(pub))
+	t.Cleanup(func() { MANIFEST_PUBLIC_KEY_HEX = previous })
+}
+
+func TestParseAndVerifyManifest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %s", err)
+	}
+	withManifestKey(t, pub)
+
+	manifestBytes, err := json.Marshal(Manifest{Entries: []ManifestEntry{
+		{File: "action-server", SHA256: "deadbeef", Size: 42},
+	}})
+	if err != nil {
+		t.Fatalf("marshaling manifest: %s", err)
+	}
+	sig := ed25519.Sign(priv, manifestBytes)
+
+	manifest, err := parseAndVerifyManifest(manifestBytes, sig)
+	if err != nil {
+		t.Fatalf("parseAndVerifyManifest: %s", err)
+	}
+	if len(manifest.Entries) != 1 || manifest.Entries[0].File != "action-server" {
+		t.Fatalf("unexpected entries: %+v", manifest.Entries)
+	}
+
+	if _, err := parseAndVerifyManifest([]byte(`{"entries":[]}`), sig); err == nil {
+		t.Fatal("expected signature verification to fail for tampered manifest bytes")
+	}
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating second test key: %s", err)
+	}
+	withManifestKey(t, otherPub)
+	if _, err := parseAndVerifyManifest(manifestBytes, sig); err == nil {
+		t.Fatal("expected signature verification to fail for the wrong public key")
+	}
+}
+
+func TestFindManifestEntry(t *testing.T) {
+	manifest := &Manifest{Entries: []ManifestEntry{
+		{File: "action-server", SHA256: "aaa", Size: 1},
+		{File: "variants/v2/action-server", SHA256: "bbb", Size: 2},
+	}}
+
+	if _, ok := findManifestEntry(manifest, "does-not-exist"); ok {
+		t.Fatal("expected no entry for an unknown file")
+	}
+	entry, ok := findManifestEntry(manifest, "variants/v2/action-server")
+	if !ok || entry.SHA256 != "bbb" {
+		t.Fatalf("expected to find the v2 entry, got %+v (ok=%t)", entry, ok)
+	}
+}
+
+func TestVerifyEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "action-server")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("writing test file: %s", err)
+	}
+
+	digest, size, err := hashFile(path)
+	if err != nil {
+		t.Fatalf("hashFile: %s", err)
+	}
+
+	if err := verifyEntry(path, ManifestEntry{File: "action-server", SHA256: digest, Size: size}); err != nil {
+		t.Fatalf("verifyEntry should succeed on a matching entry: %s", err)
+	}
+	if err := verifyEntry(path, ManifestEntry{File: "action-server", SHA256: digest, Size: size + 1}); err == nil {
+		t.Fatal("expected a size mismatch error")
+	}
+	if err := verifyEntry(path, ManifestEntry{File: "action-server", SHA256: "0000", Size: size}); err == nil {
+		t.Fatal("expected a sha256 mismatch error")
+	}
+}
+
+func TestVerifyExtractedAssetsSkipsOtherVariants(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %s", err)
+	}
+	withManifestKey(t, pub)
+
+	dir := t.TempDir()
+	content := []byte("v2 binary")
+	if err := os.WriteFile(filepath.Join(dir, "action-server"), content, 0644); err != nil {
+		t.Fatalf("writing extracted file: %s", err)
+	}
+	digest, size, err := hashFile(filepath.Join(dir, "action-server"))
+	if err != nil {
+		t.Fatalf("hashFile: %s", err)
+	}
+
+	manifestBytes, err := json.Marshal(Manifest{Entries: []ManifestEntry{
+		// Only the v2 entry matches what's on disk; the v3 entry (same
+		// extracted name, different bytes) must be skipped rather than
+		// checked against the v2 file.
+		{File: "variants/v2/action-server", SHA256: digest, Size: size},
+		{File: "variants/v3/action-server", SHA256: "mismatched", Size: size},
+	}})
+	if err != nil {
+		t.Fatalf("marshaling manifest: %s", err)
+	}
+	sig := ed25519.Sign(priv, manifestBytes)
+	previousManifest, previousSig := ASSETS_MANIFEST, ASSETS_MANIFEST_SIG
+	ASSETS_MANIFEST, ASSETS_MANIFEST_SIG = manifestBytes, sig
+	t.Cleanup(func() { ASSETS_MANIFEST, ASSETS_MANIFEST_SIG = previousManifest, previousSig })
+
+	if err := verifyExtractedAssets(dir, "v2"); err != nil {
+		t.Fatalf("verifyExtractedAssets(v2): %s", err)
+	}
+}
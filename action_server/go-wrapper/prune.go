@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+const (
+	defaultKeepVersions = 2
+	defaultPruneMaxAge  = 14 * 24 * time.Hour
+)
+
+// noPruneFlag is recognized by the wrapper itself and stripped before the
+// remaining arguments are forwarded to the wrapped executable (see
+// forwardedArgs in backup.go).
+const noPruneFlag = "--no-prune"
+
+// pruneRequested reports whether stale version directories should be
+// garbage-collected after this launch.
+func pruneRequested() bool {
+	for _, arg := range os.Args[1:] {
+		if arg == noPruneFlag {
+			return false
+		}
+	}
+	return true
+}
+
+func keepVersionsFromEnv() int {
+	if v := os.Getenv("SEMA4AI_KEEP_VERSIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return defaultKeepVersions
+}
+
+func pruneMaxAgeFromEnv() time.Duration {
+	if v := os.Getenv("SEMA4AI_PRUNE_MAX_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultPruneMaxAge
+}
+
+type versionCandidate struct {
+	name      string
+	path      string
+	touchedAt time.Time
+	hasHash   bool
+}
+
+// pruneOldVersions removes sibling version directories under rootDir, other
+// than currentVersion, keeping the `keep` most recently launched complete
+// ones. Directories with no app_hash (an extraction that never finished) are
+// removed once older than maxAge; newer ones are left alone in case another
+// process is mid-extraction.
+func pruneOldVersions(rootDir, currentVersion string, keep int, maxAge time.Duration) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return
+	}
+
+	var candidates []versionCandidate
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == currentVersion {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".bak") || strings.HasSuffix(entry.Name(), ".new") {
+			// Managed by the two-phase expansion/rollback logic, not pruning.
+			continue
+		}
+		dirPath := filepath.Join(rootDir, entry.Name())
+		_, hashErr := os.Stat(filepath.Join(dirPath, "app_hash"))
+		touchInfo, touchErr := os.Stat(filepath.Join(dirPath, "lastLaunchTouch"))
+		var touchedAt time.Time
+		if touchErr == nil {
+			touchedAt = touchInfo.ModTime()
+		}
+		candidates = append(candidates, versionCandidate{
+			name:      entry.Name(),
+			path:      dirPath,
+			touchedAt: touchedAt,
+			hasHash:   hashErr == nil,
+		})
+	}
+
+	// Most recently launched first, so the first `keep` complete versions we
+	// see are the ones to protect.
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].touchedAt.After(candidates[j].touchedAt)
+	})
+
+	kept := 0
+	for _, c := range candidates {
+		if c.hasHash {
+			if kept < keep {
+				kept++
+				continue
+			}
+			removeVersionDir(c.path)
+			continue
+		}
+
+		// Incomplete extraction: only clean it up once it's clearly stale.
+		info, err := os.Stat(c.path)
+		if err == nil && time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		removeVersionDir(c.path)
+	}
+}
+
+// removeVersionDir removes dirPath, but only after obtaining its extract
+// lock (see extractLockPath) so we never race with a concurrent
+// makeAssetExpansion, and
+// only once no process still holds its liveness lock (see
+// acquireLivenessLock), so a long-running server isn't deleted out from
+// under itself.
+func removeVersionDir(dirPath string) {
+	fileLock, err := obtainLock(extractLockPath(dirPath))
+	if err != nil {
+		if debugGoWrapper {
+			fmt.Fprintf(os.Stderr, "Skipping prune of %s: %s\n", dirPath, err)
+		}
+		return
+	}
+	defer unlock(fileLock)
+
+	if versionInUse(dirPath) {
+		if debugGoWrapper {
+			fmt.Fprintf(os.Stderr, "Skipping prune of %s: still running\n", dirPath)
+		}
+		return
+	}
+
+	if debugGoWrapper {
+		fmt.Fprintf(os.Stderr, "Pruning stale version directory: %s\n", dirPath)
+	}
+	if err := os.RemoveAll(dirPath); err != nil {
+		fmt.Fprintf(os.Stderr, "(ignored) Error pruning %s: %s\n", dirPath, err)
+	}
+}
+
+// versionInUse reports whether some process still holds the (shared)
+// liveness lock for dirPath, meaning a launch of that version is still
+// running and it's not safe to delete.
+func versionInUse(dirPath string) bool {
+	livenessLock := flock.New(livenessLockPath(dirPath))
+	locked, err := livenessLock.TryLock()
+	if err != nil {
+		// Can't prove it's safe to remove, so assume it's in use.
+		return true
+	}
+	if !locked {
+		return true
+	}
+	livenessLock.Unlock()
+	return false
+}
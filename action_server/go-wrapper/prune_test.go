@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeVersionDir creates rootDir/name with an app_hash (unless incomplete)
+// and a lastLaunchTouch stamped touchedAgo in the past. For an incomplete
+// extraction (pruneOldVersions goes by the directory's own mtime rather than
+// lastLaunchTouch, since that's what a half-finished extraction leaves
+// behind), the directory itself is backdated to touchedAgo too.
+func makeVersionDir(t *testing.T, rootDir, name string, incomplete bool, touchedAgo time.Duration) string {
+	t.Helper()
+	dirPath := filepath.Join(rootDir, name)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		t.Fatalf("creating %s: %s", dirPath, err)
+	}
+	if !incomplete {
+		if err := os.WriteFile(filepath.Join(dirPath, "app_hash"), []byte("hash"), 0644); err != nil {
+			t.Fatalf("writing app_hash in %s: %s", dirPath, err)
+		}
+	}
+	touchPath := filepath.Join(dirPath, "lastLaunchTouch")
+	if err := os.WriteFile(touchPath, []byte{}, 0644); err != nil {
+		t.Fatalf("writing lastLaunchTouch in %s: %s", dirPath, err)
+	}
+	when := time.Now().Add(-touchedAgo)
+	if err := os.Chtimes(touchPath, when, when); err != nil {
+		t.Fatalf("touching %s: %s", touchPath, err)
+	}
+	if incomplete {
+		if err := os.Chtimes(dirPath, when, when); err != nil {
+			t.Fatalf("touching %s: %s", dirPath, err)
+		}
+	}
+	return dirPath
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestPruneOldVersionsKeepsMostRecentlyLaunched(t *testing.T) {
+	root := t.TempDir()
+	current := makeVersionDir(t, root, "2.0.0", false, 0)
+	newest := makeVersionDir(t, root, "1.2.0", false, time.Hour)
+	older := makeVersionDir(t, root, "1.1.0", false, 2*time.Hour)
+	oldest := makeVersionDir(t, root, "1.0.0", false, 3*time.Hour)
+
+	pruneOldVersions(root, "2.0.0", 1, defaultPruneMaxAge)
+
+	if !exists(current) {
+		t.Error("the current version must never be pruned")
+	}
+	if !exists(newest) {
+		t.Error("the most recently launched complete version should be kept")
+	}
+	if exists(older) || exists(oldest) {
+		t.Error("older complete versions beyond the keep count should be pruned")
+	}
+}
+
+func TestPruneOldVersionsIncompleteExtraction(t *testing.T) {
+	root := t.TempDir()
+	fresh := makeVersionDir(t, root, "1.1.0-new", true, time.Minute)
+	stale := makeVersionDir(t, root, "1.0.0-new", true, 48*time.Hour)
+
+	pruneOldVersions(root, "2.0.0", 0, 24*time.Hour)
+
+	if !exists(fresh) {
+		t.Error("a recent incomplete extraction should be left alone in case it's still in progress")
+	}
+	if exists(stale) {
+		t.Error("a stale incomplete extraction should be cleaned up")
+	}
+}
+
+func TestPruneOldVersionsSkipsBakAndNewSuffixes(t *testing.T) {
+	root := t.TempDir()
+	bak := makeVersionDir(t, root, "1.0.0.bak", false, 30*24*time.Hour)
+	staging := makeVersionDir(t, root, "1.0.0.new", false, 30*24*time.Hour)
+
+	pruneOldVersions(root, "2.0.0", 0, defaultPruneMaxAge)
+
+	if !exists(bak) || !exists(staging) {
+		t.Error(".bak/.new directories are managed by the expansion/rollback logic, not pruning")
+	}
+}
+
+func TestPruneOldVersionsSkipsInUseVersion(t *testing.T) {
+	root := t.TempDir()
+	inUse := makeVersionDir(t, root, "1.0.0", false, 48*time.Hour)
+
+	acquireLivenessLock(inUse)
+
+	pruneOldVersions(root, "2.0.0", 0, defaultPruneMaxAge)
+
+	if !exists(inUse) {
+		t.Error("a version whose liveness lock is held should not be pruned")
+	}
+}
+
+func TestKeepVersionsFromEnv(t *testing.T) {
+	t.Setenv("SEMA4AI_KEEP_VERSIONS", "5")
+	if got := keepVersionsFromEnv(); got != 5 {
+		t.Errorf("keepVersionsFromEnv() = %d, want 5", got)
+	}
+
+	t.Setenv("SEMA4AI_KEEP_VERSIONS", "not-a-number")
+	if got := keepVersionsFromEnv(); got != defaultKeepVersions {
+		t.Errorf("keepVersionsFromEnv() with invalid value = %d, want default %d", got, defaultKeepVersions)
+	}
+}
+
+func TestPruneMaxAgeFromEnv(t *testing.T) {
+	t.Setenv("SEMA4AI_PRUNE_MAX_AGE", "1h")
+	if got := pruneMaxAgeFromEnv(); got != time.Hour {
+		t.Errorf("pruneMaxAgeFromEnv() = %s, want 1h", got)
+	}
+
+	t.Setenv("SEMA4AI_PRUNE_MAX_AGE", "not-a-duration")
+	if got := pruneMaxAgeFromEnv(); got != defaultPruneMaxAge {
+		t.Errorf("pruneMaxAgeFromEnv() with invalid value = %s, want default %s", got, defaultPruneMaxAge)
+	}
+}
+
+func TestNoPruneFlag(t *testing.T) {
+	previousArgs := os.Args
+	t.Cleanup(func() { os.Args = previousArgs })
+
+	os.Args = []string{"action-server", "--no-prune"}
+	if pruneRequested() {
+		t.Error("pruneRequested() should be false when --no-prune is passed")
+	}
+
+	os.Args = []string{"action-server"}
+	if !pruneRequested() {
+		t.Error("pruneRequested() should default to true")
+	}
+}
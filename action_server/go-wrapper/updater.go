@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// Updater drives a self-update of the running wrapper: it downloads the
+// platform-specific binary for a newer version, stages it alongside the
+// regular per-version asset directories and replaces the currently running
+// executable with it: atomically by rename, or by a non-atomic copy when the
+// two are on different filesystems (see replaceFile).
+type Updater struct {
+	Config RunConfig
+}
+
+// selfUpdateFlag is recognized by the wrapper itself and stripped before the
+// remaining arguments are forwarded to the wrapped executable (see
+// forwardedArgs in backup.go).
+const selfUpdateFlag = "--self-update"
+
+// selfUpdateRequested reports whether the user opted into downloading and
+// applying updates automatically, instead of just being notified about them.
+func selfUpdateRequested() bool {
+	if os.Getenv("SEMA4AI_AUTO_UPDATE") == "1" {
+		return true
+	}
+	for _, arg := range os.Args[1:] {
+		if arg == selfUpdateFlag {
+			return true
+		}
+	}
+	return false
+}
+
+// progressWriter writes a simple percentage indicator to stderr as bytes
+// flow through it. It implements io.Writer so it can be wrapped around a
+// destination file with io.MultiWriter.
+type progressWriter struct {
+	label   string
+	total   int64
+	written int64
+	lastPct int
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.written += int64(len(p))
+	if pw.total <= 0 {
+		return len(p), nil
+	}
+	pct := int(pw.written * 100 / pw.total)
+	if pct != pw.lastPct {
+		pw.lastPct = pct
+		fmt.Fprintf(os.Stderr, "\r%s... %d%%", pw.label, pct)
+		if pct == 100 {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+	return len(p), nil
+}
+
+// downloadToFile streams url to destPath, reporting progress to stderr.
+// Proxying is handled transparently by http.DefaultClient, which honors
+// HTTP_PROXY/HTTPS_PROXY the same way the existing getLatestVersion call does.
+func downloadToFile(url, destPath, label string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: unexpected status %s", url, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), DEFAULT_PERMISSIONS); err != nil {
+		return fmt.Errorf("creating staging directory: %s", err)
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("creating %s: %s", destPath, err)
+	}
+	defer out.Close()
+
+	pw := &progressWriter{label: label, total: resp.ContentLength}
+	if _, err := io.Copy(io.MultiWriter(out, pw), resp.Body); err != nil {
+		return fmt.Errorf("writing %s: %s", destPath, err)
+	}
+
+	return nil
+}
+
+// replaceFile moves src to dst, falling back to a copy when they're on
+// different filesystems/mounts (e.g. a network home, or a container with a
+// separate volume mounted for the running executable), where os.Rename fails
+// with EXDEV.
+func replaceFile(src, dst string) error {
+	renameErr := os.Rename(src, dst)
+	if renameErr == nil {
+		return nil
+	}
+	if !errors.Is(renameErr, syscall.EXDEV) {
+		return renameErr
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return renameErr
+	}
+	if err := copyFileContents(src, dst, info.Mode()); err != nil {
+		return fmt.Errorf("%s (falling back to copy after rename failed: %s)", err, renameErr)
+	}
+	return os.Remove(src)
+}
+
+// copyFileContents copies src to dst, creating/truncating dst with mode.
+func copyFileContents(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// stagingPath returns where the downloaded binary for newVersion is staged
+// before being promoted, mirroring the <exe>/internal/<version> layout used
+// by extractAndRun.
+func (u *Updater) stagingPath(newVersion string) (string, error) {
+	dir, err := computeTargetDirectory(u.Config.ExecutableName, newVersion)
+	if err != nil {
+		return "", err
+	}
+	name := u.Config.ExecutableName + ".update"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Apply downloads newVersion, verifies it and replaces the running
+// executable with it. On success the caller should tell the user to re-run
+// the command (or re-exec), since the code currently executing in memory is
+// still the old version.
+func (u *Updater) Apply(newVersion string) error {
+	staged, err := u.stagingPath(newVersion)
+	if err != nil {
+		return fmt.Errorf("computing staging path: %s", err)
+	}
+
+	manifestBase, err := manifestBaseURL(u.Config.DownloadLatestURL)
+	if err != nil {
+		return fmt.Errorf("computing manifest URL: %s", err)
+	}
+	manifest, err := fetchRemoteManifest(manifestBase)
+	if err != nil {
+		return fmt.Errorf("fetching update manifest: %s", err)
+	}
+	entryName := path.Base(u.Config.DownloadLatestURL)
+	entry, ok := findManifestEntry(manifest, entryName)
+	if !ok {
+		return fmt.Errorf("manifest has no entry for %s", entryName)
+	}
+
+	fmt.Fprintf(os.Stderr, "Downloading %s %s...\n", u.Config.ExecutableName, newVersion)
+	if err := downloadToFile(u.Config.DownloadLatestURL, staged, "Downloading"); err != nil {
+		return err
+	}
+
+	if err := verifyEntry(staged, entry); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("verifying downloaded binary: %s", err)
+	}
+
+	if err := os.Chmod(staged, DEFAULT_PERMISSIONS); err != nil {
+		return fmt.Errorf("setting permissions on %s: %s", staged, err)
+	}
+
+	running, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating running executable: %s", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		// The running .exe can't be unlinked on Windows, so move it aside
+		// first and replace it with the staged binary.
+		bak := running + ".bak"
+		os.Remove(bak) // best effort, leftover from a previous update
+		if err := os.Rename(running, bak); err != nil {
+			return fmt.Errorf("backing up %s: %s", running, err)
+		}
+		if err := replaceFile(staged, running); err != nil {
+			// Try to restore the backup so the wrapper is still usable.
+			os.Rename(bak, running)
+			return fmt.Errorf("replacing %s: %s", running, err)
+		}
+		return nil
+	}
+
+	if err := replaceFile(staged, running); err != nil {
+		return fmt.Errorf("replacing %s: %s", running, err)
+	}
+	return nil
+}
+
+// selfUpdate downloads and applies latestVersion, printing progress and
+// outcome to stderr.
+func selfUpdate(config RunConfig, latestVersion string) {
+	updater := &Updater{Config: config}
+	if err := updater.Apply(latestVersion); err != nil {
+		fmt.Fprintf(os.Stderr, "Self-update failed: %s\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nUpdated %s to %s. Please re-run the command.\n", config.ExecutableName, latestVersion)
+	os.Exit(0)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/klauspost/cpuid/v2"
+)
+
+// amd64Variant selects which amd64 microarchitecture variant to use: "",
+// "v2" or "v3" ("" meaning the baseline, v1-compatible build). It can be
+// forced via SEMA4AI_AMD64_LEVEL (mainly for testing); otherwise it probes
+// the running CPU with cpuid.
+func amd64Variant() string {
+	if override := strings.ToLower(os.Getenv("SEMA4AI_AMD64_LEVEL")); override != "" {
+		switch override {
+		case "v1":
+			return ""
+		case "v2", "v3":
+			return override
+		default:
+			fmt.Fprintf(os.Stderr, "Ignoring unknown SEMA4AI_AMD64_LEVEL=%s\n", override)
+		}
+	}
+
+	return amd64VariantForLevel(cpuid.CPU.X64Level())
+}
+
+// amd64VariantForLevel maps an x86-64 microarchitecture level (as reported by
+// cpuid.CPU.X64Level()) to the variant to use. Only v1/v2/v3 assets are
+// built, so anything v3 and above (e.g. the v4 AVX-512 level reported by
+// current server/cloud CPUs) still gets the v3 build, the best one actually
+// shipped, rather than falling through to the v1 baseline.
+func amd64VariantForLevel(level int) string {
+	switch {
+	case level >= 3:
+		return "v3"
+	case level == 2:
+		return "v2"
+	default:
+		return ""
+	}
+}
+
+// variantSuffix returns the suffix appended to the action-server executable
+// name for a given variant, e.g. "" -> "", "v2" -> "-v2".
+func variantSuffix(variant string) string {
+	if variant == "" {
+		return ""
+	}
+	return "-" + variant
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAmd64VariantOverride(t *testing.T) {
+	tests := []struct {
+		override string
+		want     string
+	}{
+		{"v1", ""},
+		{"v2", "v2"},
+		{"v3", "v3"},
+		{"bogus", unoverriddenAmd64Variant(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.override, func(t *testing.T) {
+			t.Setenv("SEMA4AI_AMD64_LEVEL", tt.override)
+			if got := amd64Variant(); got != tt.want {
+				t.Errorf("amd64Variant() with override %q = %q, want %q", tt.override, got, tt.want)
+			}
+		})
+	}
+}
+
+// unoverriddenAmd64Variant returns whatever the real CPU probe yields, for
+// comparing against an unrecognized SEMA4AI_AMD64_LEVEL value (which is
+// ignored rather than honored).
+func unoverriddenAmd64Variant(t *testing.T) string {
+	t.Helper()
+	previous, had := os.LookupEnv("SEMA4AI_AMD64_LEVEL")
+	os.Unsetenv("SEMA4AI_AMD64_LEVEL")
+	defer func() {
+		if had {
+			os.Setenv("SEMA4AI_AMD64_LEVEL", previous)
+		}
+	}()
+	return amd64Variant()
+}
+
+func TestAmd64VariantForLevel(t *testing.T) {
+	tests := []struct {
+		level int
+		want  string
+	}{
+		{0, ""},
+		{1, ""},
+		{2, "v2"},
+		{3, "v3"},
+		// Only v1/v2/v3 assets are built: a v4 (or higher) CPU must still get
+		// the best shipped build, v3, not fall through to the v1 baseline.
+		{4, "v3"},
+		{5, "v3"},
+	}
+	for _, tt := range tests {
+		if got := amd64VariantForLevel(tt.level); got != tt.want {
+			t.Errorf("amd64VariantForLevel(%d) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestVariantSuffix(t *testing.T) {
+	tests := map[string]string{
+		"":   "",
+		"v2": "-v2",
+		"v3": "-v3",
+	}
+	for variant, want := range tests {
+		if got := variantSuffix(variant); got != want {
+			t.Errorf("variantSuffix(%q) = %q, want %q", variant, got, want)
+		}
+	}
+}
+
+func TestVariantEntryName(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		variant string
+		want    string
+		wantOk  bool
+	}{
+		{"shared file, any variant", "action-server-assets/templates/x.html", "v2", "action-server-assets/templates/x.html", true},
+		{"matching v2 entry", "variants/v2/action-server", "v2", "action-server", true},
+		{"matching v1 (empty) entry", "variants/v1/action-server", "", "action-server", true},
+		{"non-matching variant", "variants/v2/action-server", "v3", "", false},
+		{"variant directory entry itself", "variants/v2", "v2", "", false},
+		{"unselected variant defaults to v1", "variants/v2/action-server", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ok := variantEntryName(tt.entry, tt.variant)
+			if ok != tt.wantOk || name != tt.want {
+				t.Errorf("variantEntryName(%q, %q) = (%q, %t), want (%q, %t)", tt.entry, tt.variant, name, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}